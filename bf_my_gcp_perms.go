@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -14,11 +12,66 @@ import (
 	"strings"
 	"sync"
 
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/cloudresourcemanager/v3"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/impersonate"
 	"google.golang.org/api/option"
 )
 
+// cloudPlatformScope is the OAuth scope required for the Cloud Resource
+// Manager and IAM calls this tool makes.
+const cloudPlatformScope = "https://www.googleapis.com/auth/cloud-platform"
+
+// buildTokenSource resolves the credentials to use for API calls.
+//
+// If credentialsPath is set, it is read as a service-account JWT key file.
+// Otherwise Application Default Credentials are used, which covers gcloud
+// user credentials, workload identity, and the GCE/GKE/Cloud Run metadata
+// server. When impersonateSA is set, the resolved credentials are exchanged
+// for a short-lived token for that service account via the IAM Credentials
+// API, optionally hopping through the given delegate chain.
+func buildTokenSource(ctx context.Context, credentialsPath, impersonateSA string, delegates []string) (oauth2.TokenSource, error) {
+	var base oauth2.TokenSource
+
+	if credentialsPath != "" {
+		credentialsBytes, err := ioutil.ReadFile(credentialsPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading credentials file: %w", err)
+		}
+
+		config, err := google.JWTConfigFromJSON(credentialsBytes, cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("parsing credentials file: %w", err)
+		}
+
+		base = config.TokenSource(ctx)
+	} else {
+		creds, err := google.FindDefaultCredentials(ctx, cloudPlatformScope)
+		if err != nil {
+			return nil, fmt.Errorf("finding application default credentials: %w", err)
+		}
+
+		base = creds.TokenSource
+	}
+
+	if impersonateSA == "" {
+		return base, nil
+	}
+
+	ts, err := impersonate.CredentialsTokenSource(ctx, impersonate.CredentialsConfig{
+		TargetPrincipal: impersonateSA,
+		Scopes:          []string{cloudPlatformScope},
+		Delegates:       delegates,
+	}, option.WithTokenSource(base))
+	if err != nil {
+		return nil, fmt.Errorf("impersonating %s: %w", impersonateSA, err)
+	}
+
+	return ts, nil
+}
+
 // downloadGCPPermissions fetches the list of all available GCP permissions from the IAM permissions reference page.
 func downloadGCPPermissions() ([]string, error) {
 	baseURL := "https://cloud.google.com/iam/docs/permissions-reference"
@@ -58,10 +111,10 @@ func downloadGCPPermissions() ([]string, error) {
 
 	// Extract permissions from the table in the iframe content.
 	permissionsRegex := regexp.MustCompile(`<td id="([^"]+)">`)
-	matches = permissionsRegex.FindAllStringSubmatch(string(frameBody), -1)
+	tableMatches := permissionsRegex.FindAllStringSubmatch(string(frameBody), -1)
 
 	var permissions []string
-	for _, match := range matches {
+	for _, match := range tableMatches {
 		permissions = append(permissions, match[1])
 	}
 
@@ -100,97 +153,212 @@ func main() {
 	project := flag.String("project", "", "GCP project ID")
 	folder := flag.String("folder", "", "GCP folder ID")
 	organization := flag.String("organization", "", "GCP organization ID")
-	credentials := flag.String("credentials", "", "Path to credentials.json")
+	resourceFlag := flag.String("resource", "", "Check a specific resource instead of a project/folder/organization: gs://bucket, or a //<service>.googleapis.com/... resource URL")
+	all := flag.Bool("all", false, "Discover and check every project, folder, and organization reachable by the caller")
+	credentials := flag.String("credentials", "", "Path to credentials.json (omit to use Application Default Credentials)")
+	impersonateSA := flag.String("impersonate", "", "Service account email to impersonate via short-lived token")
+	delegatesFlag := flag.String("delegates", "", "Comma-separated chain of service accounts to delegate through to reach -impersonate")
 	verbose := flag.Bool("verbose", false, "Verbose output")
 	threads := flag.Int("threads", 3, "Number of threads")
 	chunkSize := flag.Int("size", 50, "Chunk size for permission checks")
+	output := flag.String("output", "", "File to write results to (default: stdout)")
+	format := flag.String("format", "text", "Output format: text, json, csv, or sarif")
+	permissionsFile := flag.String("permissions-file", "", "Read permissions from a file instead of scraping/caching (one per line, or gcloud iam list-testable-permissions --format=json)")
+	cacheTTL := flag.Duration("cache-ttl", defaultCacheTTL, "How long the cached permissions catalog stays fresh")
+	refresh := flag.Bool("refresh", false, "Force re-downloading the permissions catalog instead of using the cache")
 	flag.Parse()
 
+	var delegates []string
+	if *delegatesFlag != "" {
+		delegates = strings.Split(*delegatesFlag, ",")
+	}
+
 	// Ensure at least one resource is specified.
-	if *project == "" && *folder == "" && *organization == "" {
-		fmt.Println("You must specify either a project, folder, or organization.")
+	if !*all && *resourceFlag == "" && *project == "" && *folder == "" && *organization == "" {
+		fmt.Println("You must specify either a project, folder, organization, -all, or -resource.")
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	// Load the credentials file.
-	credentialsFile, err := os.Open(*credentials)
-	if err != nil {
-		fmt.Printf("Error reading credentials file: %v\n", err)
+	if *all && (*resourceFlag != "" || *project != "" || *folder != "" || *organization != "") {
+		fmt.Println("-all is mutually exclusive with -resource, -project, -folder, and -organization: -all enumerates every reachable project/folder/organization, which makes a single target meaningless.")
 		os.Exit(1)
 	}
-	defer credentialsFile.Close()
 
-	credentialsBytes, err := ioutil.ReadAll(credentialsFile)
-	if err != nil {
-		fmt.Printf("Error reading credentials file: %v\n", err)
+	// A non-positive thread count would leave the worker pool empty, so the
+	// unbuffered work channel blocks forever on the first send.
+	if *threads < 1 {
+		fmt.Println("-threads must be at least 1.")
 		os.Exit(1)
 	}
 
-	// Parse the credentials to create a JWT config.
-	config, err := google.JWTConfigFromJSON(credentialsBytes, "https://www.googleapis.com/auth/cloud-platform")
+	// Resolve credentials: an explicit key file, or ADC if none was given,
+	// optionally exchanged for an impersonated service account's token.
+	ctx := context.Background()
+	tokenSource, err := buildTokenSource(ctx, *credentials, *impersonateSA, delegates)
 	if err != nil {
-		fmt.Printf("Error parsing credentials file: %v\n", err)
+		fmt.Printf("Error resolving credentials: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Initialize the Cloud Resource Manager API client.
-	ctx := context.Background()
-	client, err := cloudresourcemanager.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx)))
+	// Initialize the Cloud Resource Manager and IAM API clients.
+	client, err := cloudresourcemanager.NewService(ctx, option.WithTokenSource(tokenSource))
 	if err != nil {
 		fmt.Printf("Error creating Cloud Resource Manager client: %v\n", err)
 		os.Exit(1)
 	}
 
-	// Download the list of permissions.
-	permissions, err := downloadGCPPermissions()
-	if err != nil || len(permissions) == 0 {
-		fmt.Printf("Error downloading GCP permissions: %v\n", err)
+	iamClient, err := iam.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		fmt.Printf("Error creating IAM client: %v\n", err)
+		os.Exit(1)
+	}
+
+	resourcePath := "projects/" + *project
+	if *folder != "" {
+		resourcePath = "folders/" + *folder
+	} else if *organization != "" {
+		resourcePath = "organizations/" + *organization
+	}
+
+	var target Target
+	if *resourceFlag != "" {
+		target, err = parseTarget(ctx, tokenSource, *resourceFlag)
+		if err != nil {
+			fmt.Printf("Error parsing -resource: %v\n", err)
+			os.Exit(1)
+		}
+	} else if !*all {
+		target = crmTarget{client: client, path: resourcePath}
+	}
+
+	// QueryTestablePermissions only makes sense against a concrete CRM
+	// resource; -all and -resource have no single such resource to fall
+	// back to if the scrape fails.
+	var fallbackResourceName string
+	if *resourceFlag == "" && !*all {
+		fallbackResourceName = fullResourceName(resourcePath)
+	}
+
+	permissions, err := loadPermissions(ctx, iamClient, *permissionsFile, *refresh, *cacheTTL, fallbackResourceName, *verbose)
+	if err != nil {
+		fmt.Printf("Error loading permissions catalog: %v\n", err)
 		os.Exit(1)
 	}
 
 	sort.Strings(permissions)
-	fmt.Printf("Downloaded %d GCP permissions\n", len(permissions))
+	fmt.Printf("Using %d GCP permissions\n", len(permissions))
 
-	// Divide permissions into chunks for parallel processing.
-	chunks := divideChunks(permissions, *chunkSize)
+	// Role grouping is only useful in the machine-readable formats, and
+	// listing every predefined role is not cheap, so only pay for it there.
+	var roleIndex map[string][]string
+	if *format == "json" || *format == "csv" || *format == "sarif" {
+		roleIndex, err = buildRoleIndex(ctx, iamClient)
+		if err != nil {
+			fmt.Printf("Error building role index: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *all {
+		resources, err := discoverResources(ctx, client)
+		if err != nil {
+			fmt.Printf("Error discovering resources: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Discovered %d reachable resources\n", len(resources))
+
+		perResource := checkAllResources(ctx, client, resources, permissions, *chunkSize, *threads, *verbose)
+
+		paths := make([]string, 0, len(perResource))
+		for path := range perResource {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		results := make([]ResourceResult, 0, len(paths))
+		for _, path := range paths {
+			perms := perResource[path]
+			results = append(results, ResourceResult{
+				Resource:    path,
+				Permissions: perms,
+				Roles:       permissionRoles(roleIndex, perms),
+				Findings:    findEscalationPaths(perms),
+			})
+		}
+
+		if err := writeResults(results, *format, *output); err != nil {
+			fmt.Printf("Error writing results: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Filtering to the permissions this target actually accepts avoids
+	// wasting chunks on INVALID_ARGUMENT for permissions from other services.
+	filtered := target.FilterPermissions(permissions)
+	if *verbose {
+		fmt.Printf("%s accepts %d of %d permissions\n", target.Path(), len(filtered), len(permissions))
+	}
+
+	// Check permission chunks through a worker pool bounded by -threads,
+	// rather than one goroutine per chunk, with retries and adaptive
+	// chunk sizing shared across workers.
+	sizer := newChunkSizer(*chunkSize)
+	work := make(chan []string)
 	var wg sync.WaitGroup
 	var mu sync.Mutex
 	havePerms := []string{}
 
-	// Process each chunk in a separate goroutine.
-	for _, chunk := range chunks {
+	for i := 0; i < *threads; i++ {
 		wg.Add(1)
-		go func(chunk []string) {
+		go func() {
 			defer wg.Done()
+			for chunk := range work {
+				foundPerms, err := checkPermissionsWithRetry(ctx, chunk, sizer, target.TestPermissions)
+				if err != nil {
+					fmt.Printf("Error checking permissions: %v\n", err)
+				}
 
-			// Determine the resource type based on the input flags.
-			resource := "projects/" + *project
-			if *folder != "" {
-				resource = "folders/" + *folder
-			} else if *organization != "" {
-				resource = "organizations/" + *organization
-			}
+				if *verbose {
+					fmt.Printf("Found: %v\n", foundPerms)
+				}
 
-			// Check permissions for the current chunk.
-			foundPerms, err := checkPermissions(chunk, client, resource)
-			if err != nil {
-				fmt.Printf("Error checking permissions: %v\n", err)
-				return
+				mu.Lock()
+				havePerms = append(havePerms, foundPerms...)
+				mu.Unlock()
 			}
+		}()
+	}
 
-			if *verbose {
-				fmt.Printf("Found: %v\n", foundPerms)
+	// Slice off the next chunk against the sizer's current value as each
+	// one is dispatched, rather than dividing the whole queue up front, so
+	// a shrink or grow from an earlier chunk actually changes the size of
+	// the chunks still to come.
+	go func() {
+		defer close(work)
+		remaining := filtered
+		for len(remaining) > 0 {
+			n := sizer.size()
+			if n > len(remaining) {
+				n = len(remaining)
 			}
+			work <- remaining[:n]
+			remaining = remaining[n:]
+		}
+	}()
+
+	wg.Wait()
 
-			// Append found permissions to the result in a thread-safe manner.
-			mu.Lock()
-			havePerms = append(havePerms, foundPerms...)
-			mu.Unlock()
-		}(chunk)
+	result := ResourceResult{
+		Resource:    target.Path(),
+		Permissions: havePerms,
+		Roles:       permissionRoles(roleIndex, havePerms),
+		Findings:    findEscalationPaths(havePerms),
 	}
 
-	// Wait for all goroutines to complete.
-	wg.Wait()
-	fmt.Printf("[+] Your Permissions:\n- %s\n", strings.Join(havePerms, "\n- "))
+	if err := writeResults([]ResourceResult{result}, *format, *output); err != nil {
+		fmt.Printf("Error writing results: %v\n", err)
+		os.Exit(1)
+	}
 }
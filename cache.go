@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/iam/v1"
+)
+
+// defaultCacheTTL is how long the cached permissions catalog is considered
+// fresh before -refresh is implied.
+const defaultCacheTTL = 7 * 24 * time.Hour
+
+const cacheFileName = "permissions.json"
+
+// permissionsCache is the on-disk shape of the cached permissions catalog.
+type permissionsCache struct {
+	FetchedAt   time.Time `json:"fetched_at"`
+	Permissions []string  `json:"permissions"`
+}
+
+// cacheFilePath returns where the permissions catalog is cached, honoring
+// $XDG_CACHE_HOME when set.
+func cacheFilePath() (string, error) {
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return "", err
+		}
+		base = dir
+	}
+
+	return filepath.Join(base, "gcp-bruteforce", cacheFileName), nil
+}
+
+// loadCachedPermissions returns the cached permission catalog if it exists
+// and is younger than ttl.
+func loadCachedPermissions(ttl time.Duration) ([]string, bool) {
+	path, err := cacheFilePath()
+	if err != nil {
+		return nil, false
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+
+	var cache permissionsCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, false
+	}
+
+	if time.Since(cache.FetchedAt) > ttl {
+		return nil, false
+	}
+
+	return cache.Permissions, true
+}
+
+// saveCachedPermissions writes perms to the cache file, creating its parent
+// directory if needed.
+func saveCachedPermissions(perms []string) error {
+	path, err := cacheFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(permissionsCache{FetchedAt: time.Now(), Permissions: perms}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0o644)
+}
+
+// gcloudTestablePermission mirrors one entry in the JSON array produced by
+// `gcloud iam list-testable-permissions --format=json`.
+type gcloudTestablePermission struct {
+	Name string `json:"name"`
+}
+
+// loadPermissionsFile reads a user-supplied permissions list from path,
+// accepting either one permission per line or the JSON array dumped by
+// `gcloud iam list-testable-permissions --format=json`.
+func loadPermissionsFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading permissions file: %w", err)
+	}
+
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "[") {
+		var entries []gcloudTestablePermission
+		if err := json.Unmarshal([]byte(trimmed), &entries); err != nil {
+			return nil, fmt.Errorf("parsing permissions JSON: %w", err)
+		}
+
+		perms := make([]string, 0, len(entries))
+		for _, e := range entries {
+			perms = append(perms, e.Name)
+		}
+		return perms, nil
+	}
+
+	var perms []string
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			perms = append(perms, line)
+		}
+	}
+	return perms, nil
+}
+
+// fullResourceName builds the full resource name QueryTestablePermissions
+// expects for a Cloud Resource Manager resource path like
+// "projects/my-project".
+func fullResourceName(resourcePath string) string {
+	return "//cloudresourcemanager.googleapis.com/" + resourcePath
+}
+
+// loadPermissions resolves the permissions catalog to brute-force, in order
+// of precedence: an explicit -permissions-file, then the on-disk cache
+// (unless refresh is set), then a fresh scrape of the permissions-reference
+// page, falling back to QueryTestablePermissions against fallbackResourceName
+// if the scrape fails. fallbackResourceName must be a full resource name
+// (see fullResourceName) for a concrete project, folder, or organization; it
+// is empty when the caller has no single CRM resource to fall back to (e.g.
+// -all or -resource), in which case a scrape failure is a hard error instead
+// of querying a made-up resource. A freshly fetched catalog is written back
+// to the cache.
+func loadPermissions(ctx context.Context, iamClient *iam.Service, permissionsFile string, refresh bool, ttl time.Duration, fallbackResourceName string, verbose bool) ([]string, error) {
+	if permissionsFile != "" {
+		return loadPermissionsFile(permissionsFile)
+	}
+
+	if !refresh {
+		if cached, ok := loadCachedPermissions(ttl); ok {
+			if verbose {
+				fmt.Println("Using cached GCP permissions catalog")
+			}
+			return cached, nil
+		}
+	}
+
+	permissions, err := downloadGCPPermissions()
+	if err != nil || len(permissions) == 0 {
+		if fallbackResourceName == "" {
+			return nil, fmt.Errorf("scraping the permissions reference failed (%w) and there is no concrete -project/-folder/-organization to query testable permissions against; pass -permissions-file instead", err)
+		}
+
+		if verbose {
+			fmt.Printf("Scraping permissions reference failed (%v), falling back to QueryTestablePermissions\n", err)
+		}
+
+		permissions, err = queryTestablePermissions(ctx, iamClient, fallbackResourceName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := saveCachedPermissions(permissions); err != nil && verbose {
+		fmt.Printf("Warning: could not write permissions cache: %v\n", err)
+	}
+
+	return permissions, nil
+}
+
+// queryTestablePermissions asks the IAM API directly for every permission
+// that is testable against fullResourceName. It is used as a fallback when
+// scraping the permissions-reference page fails, since it is an
+// authoritative (if resource-scoped) source for the permissions catalog.
+func queryTestablePermissions(ctx context.Context, client *iam.Service, resourceName string) ([]string, error) {
+	var perms []string
+
+	err := client.Permissions.QueryTestablePermissions(&iam.QueryTestablePermissionsRequest{
+		FullResourceName: resourceName,
+	}).Pages(ctx, func(page *iam.QueryTestablePermissionsResponse) error {
+		for _, p := range page.Permissions {
+			perms = append(perms, p.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("querying testable permissions: %w", err)
+	}
+
+	sort.Strings(perms)
+	return perms, nil
+}
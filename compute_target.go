@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/compute/v1"
+	"google.golang.org/api/option"
+)
+
+var computeInstanceRegexp = regexp.MustCompile(`^//compute\.googleapis\.com/projects/([^/]+)/zones/([^/]+)/instances/([^/]+)$`)
+
+// computeInstanceTarget is a Compute Engine instance, checked via
+// compute.Instances.TestIamPermissions.
+type computeInstanceTarget struct {
+	client   *compute.Service
+	project  string
+	zone     string
+	instance string
+}
+
+func newComputeInstanceTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceURL string) (Target, error) {
+	m := computeInstanceRegexp.FindStringSubmatch(resourceURL)
+	if m == nil {
+		return nil, fmt.Errorf("expected //compute.googleapis.com/projects/PROJECT/zones/ZONE/instances/INSTANCE, got %q", resourceURL)
+	}
+
+	client, err := compute.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating compute client: %w", err)
+	}
+
+	return computeInstanceTarget{client: client, project: m[1], zone: m[2], instance: m[3]}, nil
+}
+
+func (t computeInstanceTarget) Path() string {
+	return fmt.Sprintf("//compute.googleapis.com/projects/%s/zones/%s/instances/%s", t.project, t.zone, t.instance)
+}
+
+func (t computeInstanceTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "compute.")
+}
+
+func (t computeInstanceTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Instances.TestIamPermissions(t.project, t.zone, t.instance, &compute.TestPermissionsRequest{
+		Permissions: perms,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
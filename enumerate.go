@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// resource identifies a single CRM resource discovered in -all mode.
+type resource struct {
+	kind string // "projects", "folders", or "organizations"
+	id   string
+	name string
+}
+
+// path returns the resource name as expected by TestIamPermissions, e.g.
+// "projects/my-project".
+func (r resource) path() string {
+	return r.kind + "/" + r.id
+}
+
+// discoverResources enumerates every project, folder, and organization the
+// caller (or impersonated principal) can see, using the CRM search
+// endpoints. This is the -all counterpart to a single
+// -project|-folder|-organization target.
+func discoverResources(ctx context.Context, client *cloudresourcemanager.Service) ([]resource, error) {
+	var resources []resource
+
+	if err := client.Projects.Search().Pages(ctx, func(page *cloudresourcemanager.SearchProjectsResponse) error {
+		for _, p := range page.Projects {
+			resources = append(resources, resource{kind: "projects", id: p.ProjectId, name: p.DisplayName})
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("searching projects: %w", err)
+	}
+
+	if err := client.Folders.Search().Pages(ctx, func(page *cloudresourcemanager.SearchFoldersResponse) error {
+		for _, f := range page.Folders {
+			resources = append(resources, resource{kind: "folders", id: strings.TrimPrefix(f.Name, "folders/"), name: f.DisplayName})
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("searching folders: %w", err)
+	}
+
+	if err := client.Organizations.Search().Pages(ctx, func(page *cloudresourcemanager.SearchOrganizationsResponse) error {
+		for _, o := range page.Organizations {
+			resources = append(resources, resource{kind: "organizations", id: strings.TrimPrefix(o.Name, "organizations/"), name: o.DisplayName})
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("searching organizations: %w", err)
+	}
+
+	return resources, nil
+}
+
+// resourcePermissions maps a resource's path to the permissions the caller
+// holds there, as produced by checkAllResources.
+type resourcePermissions map[string][]string
+
+// checkAllResources tests permissions against every discovered resource
+// using a worker pool of size threads, so -all checks at most threads
+// resources concurrently instead of fanning out one goroutine per resource.
+// Chunk size adapts across the whole run via a shared chunkSizer, since a
+// resource type that rejects large chunks on one resource will reject them
+// on every other resource of the same kind too.
+func checkAllResources(ctx context.Context, client *cloudresourcemanager.Service, resources []resource, permissions []string, chunkSize, threads int, verbose bool) resourcePermissions {
+	results := make(resourcePermissions, len(resources))
+	var mu sync.Mutex
+	sizer := newChunkSizer(chunkSize)
+
+	work := make(chan resource)
+	var wg sync.WaitGroup
+
+	for i := 0; i < threads; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range work {
+				target := crmTarget{client: client, path: r.path()}
+				var found []string
+
+				// Slice off the next chunk against the sizer's current value as
+				// each one is dispatched, rather than dividing the whole
+				// permissions list up front, so a shrink or grow from an earlier
+				// chunk actually changes the size of the chunks still to come
+				// for this resource.
+				remaining := permissions
+				for len(remaining) > 0 {
+					n := sizer.size()
+					if n > len(remaining) {
+						n = len(remaining)
+					}
+					chunk := remaining[:n]
+					remaining = remaining[n:]
+
+					foundPerms, err := checkPermissionsWithRetry(ctx, chunk, sizer, target.TestPermissions)
+					if err != nil && verbose {
+						fmt.Printf("[!] %s: %v\n", r.path(), err)
+					}
+					found = append(found, foundPerms...)
+				}
+
+				if verbose {
+					fmt.Printf("[+] %s: %d permissions\n", r.path(), len(found))
+				}
+
+				mu.Lock()
+				results[r.path()] = found
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, r := range resources {
+		work <- r
+	}
+	close(work)
+	wg.Wait()
+
+	return results
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+var kmsKeyRegexp = regexp.MustCompile(`^//cloudkms\.googleapis\.com/(projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+)$`)
+
+// kmsKeyTarget is a Cloud KMS key, checked via
+// cloudkms.Projects.Locations.KeyRings.CryptoKeys.TestIamPermissions.
+type kmsKeyTarget struct {
+	client *cloudkms.Service
+	key    string
+}
+
+func newKMSKeyTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceURL string) (Target, error) {
+	m := kmsKeyRegexp.FindStringSubmatch(resourceURL)
+	if m == nil {
+		return nil, fmt.Errorf("expected //cloudkms.googleapis.com/projects/P/locations/L/keyRings/KR/cryptoKeys/CK, got %q", resourceURL)
+	}
+
+	client, err := cloudkms.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating cloudkms client: %w", err)
+	}
+
+	return kmsKeyTarget{client: client, key: m[1]}, nil
+}
+
+func (t kmsKeyTarget) Path() string { return "//cloudkms.googleapis.com/" + t.key }
+
+func (t kmsKeyTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "cloudkms.")
+}
+
+func (t kmsKeyTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Projects.Locations.KeyRings.CryptoKeys.TestIamPermissions(t.key, &cloudkms.TestIamPermissionsRequest{
+		Permissions: perms,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
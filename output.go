@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/iam/v1"
+)
+
+// escalationPermissions maps known IAM privilege-escalation primitives to a
+// human-readable description of the attack path they enable.
+var escalationPermissions = map[string]string{
+	"iam.serviceAccounts.getAccessToken":   "mint an access token for another service account",
+	"iam.serviceAccounts.actAs":            "act as another service account when attaching it to a new resource",
+	"iam.serviceAccounts.signJwt":          "sign a JWT as another service account",
+	"iam.serviceAccountKeys.create":        "create a long-lived key for another service account",
+	"deploymentmanager.deployments.create": "create a Deployment Manager deployment that runs as its service account",
+	"cloudbuild.builds.create":             "run a Cloud Build build as its (often highly-privileged) service account",
+	"cloudfunctions.functions.create":      "deploy a Cloud Function that runs as its service account",
+	"compute.instances.create":             "create a Compute instance that runs as its attached service account",
+}
+
+// Finding is a held permission that is a known privilege-escalation
+// primitive.
+type Finding struct {
+	Permission  string `json:"permission"`
+	Severity    string `json:"severity"`
+	Description string `json:"description"`
+}
+
+// findEscalationPaths flags any permission in perms that appears in
+// escalationPermissions.
+func findEscalationPaths(perms []string) []Finding {
+	var findings []Finding
+	for _, p := range perms {
+		if desc, ok := escalationPermissions[p]; ok {
+			findings = append(findings, Finding{Permission: p, Severity: "high", Description: desc})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Permission < findings[j].Permission })
+	return findings
+}
+
+// buildRoleIndex fetches every predefined IAM role and returns a map from
+// permission to the roles that grant it, so findings can be explained in
+// terms of the roles a caller would need to be granted.
+func buildRoleIndex(ctx context.Context, client *iam.Service) (map[string][]string, error) {
+	index := make(map[string][]string)
+
+	err := client.Roles.List().View("FULL").Pages(ctx, func(page *iam.ListRolesResponse) error {
+		for _, role := range page.Roles {
+			for _, perm := range role.IncludedPermissions {
+				index[perm] = append(index[perm], role.Name)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing IAM roles: %w", err)
+	}
+
+	return index, nil
+}
+
+// permissionRoles narrows a role index down to just the given permissions,
+// so a per-resource result only carries the roles relevant to it.
+func permissionRoles(index map[string][]string, perms []string) map[string][]string {
+	if index == nil {
+		return nil
+	}
+
+	narrowed := make(map[string][]string, len(perms))
+	for _, p := range perms {
+		if roles, ok := index[p]; ok {
+			narrowed[p] = roles
+		}
+	}
+	return narrowed
+}
+
+// ResourceResult is one resource's worth of results, in the shape shared by
+// the text, json, csv, and sarif writers.
+type ResourceResult struct {
+	Resource    string              `json:"resource"`
+	Permissions []string            `json:"permissions"`
+	Roles       map[string][]string `json:"roles,omitempty"`
+	Findings    []Finding           `json:"findings,omitempty"`
+}
+
+// writeResults renders results in the requested format and writes them to
+// outputPath, or stdout if outputPath is empty.
+func writeResults(results []ResourceResult, format, outputPath string) error {
+	w := os.Stdout
+	if outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("creating output file: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	switch format {
+	case "", "text":
+		return writeText(w, results)
+	case "json":
+		return writeJSON(w, results)
+	case "csv":
+		return writeCSV(w, results)
+	case "sarif":
+		return writeSARIF(w, results)
+	default:
+		return fmt.Errorf("unknown format %q (want text, json, csv, or sarif)", format)
+	}
+}
+
+func writeText(w *os.File, results []ResourceResult) error {
+	for _, r := range results {
+		fmt.Fprintf(w, "[+] %s (%d permissions):\n- %s\n", r.Resource, len(r.Permissions), strings.Join(r.Permissions, "\n- "))
+		for _, f := range r.Findings {
+			fmt.Fprintf(w, "[!] %s: %s (%s) can %s\n", r.Resource, f.Permission, f.Severity, f.Description)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w *os.File, results []ResourceResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func writeCSV(w *os.File, results []ResourceResult) error {
+	cw := csv.NewWriter(w)
+	defer cw.Flush()
+
+	if err := cw.Write([]string{"resource", "permission", "roles", "finding_severity", "finding_description"}); err != nil {
+		return err
+	}
+
+	for _, r := range results {
+		findingByPerm := make(map[string]Finding, len(r.Findings))
+		for _, f := range r.Findings {
+			findingByPerm[f.Permission] = f
+		}
+
+		for _, p := range r.Permissions {
+			f := findingByPerm[p]
+			if err := cw.Write([]string{r.Resource, p, strings.Join(r.Roles[p], "|"), f.Severity, f.Description}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// The sarif* types implement the minimal subset of the SARIF 2.1.0 schema
+// needed for GitHub code scanning (or any other SARIF consumer) to ingest
+// escalation findings.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+func writeSARIF(w *os.File, results []ResourceResult) error {
+	run := sarifRun{Tool: sarifTool{Driver: sarifDriver{Name: "bf-my-gcp-perms", Version: "1.0.0"}}}
+
+	for _, r := range results {
+		for _, f := range r.Findings {
+			level := "warning"
+			if f.Severity == "high" {
+				level = "error"
+			}
+
+			run.Results = append(run.Results, sarifResult{
+				RuleID:  f.Permission,
+				Level:   level,
+				Message: sarifMessage{Text: fmt.Sprintf("%s holds %s, which can %s", r.Resource, f.Permission, f.Description)},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: r.Resource}},
+				}},
+			})
+		}
+	}
+
+	log := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(log)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/pubsub/v1"
+)
+
+var pubsubTopicRegexp = regexp.MustCompile(`^//pubsub\.googleapis\.com/(projects/[^/]+/topics/[^/]+)$`)
+
+// pubsubTopicTarget is a Pub/Sub topic, checked via
+// pubsub.Projects.Topics.TestIamPermissions.
+type pubsubTopicTarget struct {
+	client *pubsub.Service
+	topic  string
+}
+
+func newPubsubTopicTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceURL string) (Target, error) {
+	m := pubsubTopicRegexp.FindStringSubmatch(resourceURL)
+	if m == nil {
+		return nil, fmt.Errorf("expected //pubsub.googleapis.com/projects/PROJECT/topics/TOPIC, got %q", resourceURL)
+	}
+
+	client, err := pubsub.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating pubsub client: %w", err)
+	}
+
+	return pubsubTopicTarget{client: client, topic: m[1]}, nil
+}
+
+func (t pubsubTopicTarget) Path() string { return "//pubsub.googleapis.com/" + t.topic }
+
+func (t pubsubTopicTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "pubsub.")
+}
+
+func (t pubsubTopicTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Projects.Topics.TestIamPermissions(t.topic, &pubsub.TestIamPermissionsRequest{
+		Permissions: perms,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
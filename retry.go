@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"google.golang.org/api/googleapi"
+)
+
+// minChunkSize is the smallest a chunk is allowed to shrink to before a
+// split-and-retry gives up and reports the underlying error.
+const minChunkSize = 1
+
+// errChunkRejected signals that the whole chunk was rejected with
+// INVALID_ARGUMENT and needs to be split and retried, rather than backed
+// off and retried as-is.
+var errChunkRejected = errors.New("permission chunk rejected with INVALID_ARGUMENT")
+
+// chunkSizer tracks an adaptive chunk size shared across workers checking
+// the same target: it halves on repeated 400s and grows back towards its
+// configured ceiling on success, so one resource type that rejects large
+// chunks doesn't force every other chunk down to the same size forever.
+type chunkSizer struct {
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func newChunkSizer(initial int) *chunkSizer {
+	return &chunkSizer{current: initial, max: initial}
+}
+
+func (c *chunkSizer) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.current
+}
+
+func (c *chunkSizer) shrink() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current > minChunkSize {
+		c.current = (c.current + 1) / 2
+	}
+}
+
+func (c *chunkSizer) grow() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current < c.max {
+		c.current += c.current/2 + 1
+		if c.current > c.max {
+			c.current = c.max
+		}
+	}
+}
+
+// checkPermissionsWithRetry calls test (a Target's TestPermissions, or
+// anything with the same shape) with exponential backoff on rate-limit
+// errors, honoring the server's Retry-After when present, and splits the
+// chunk in half and retries each half when the API rejects the whole chunk
+// with INVALID_ARGUMENT, which happens when a single permission in the
+// chunk doesn't apply to this target.
+func checkPermissionsWithRetry(ctx context.Context, perms []string, sizer *chunkSizer, test func(context.Context, []string) ([]string, error)) ([]string, error) {
+	bo := backoff.NewExponentialBackOff()
+	bo.InitialInterval = 10 * time.Millisecond
+	bo.MaxInterval = 10 * time.Second
+
+	var found []string
+	operation := func() error {
+		result, err := test(ctx, perms)
+		if err == nil {
+			found = result
+			sizer.grow()
+			return nil
+		}
+
+		var gerr *googleapi.Error
+		if errors.As(err, &gerr) {
+			switch {
+			case gerr.Code == 400:
+				sizer.shrink()
+				if len(perms) > 1 {
+					return backoff.Permanent(errChunkRejected)
+				}
+			case gerr.Code == 429 || isQuotaExceeded(gerr):
+				if wait := retryAfter(gerr); wait > 0 {
+					time.Sleep(wait)
+				}
+				return err
+			}
+		}
+
+		return backoff.Permanent(err)
+	}
+
+	err := backoff.Retry(operation, backoff.WithContext(bo, ctx))
+	if errors.Is(err, errChunkRejected) {
+		// Each half is tested independently, so a permission that's
+		// inapplicable in one half must not discard permissions that were
+		// genuinely confirmed in the other: always accumulate both halves'
+		// results and only propagate whichever half's error (if any).
+		mid := len(perms) / 2
+		left, lerr := checkPermissionsWithRetry(ctx, perms[:mid], sizer, test)
+		right, rerr := checkPermissionsWithRetry(ctx, perms[mid:], sizer, test)
+		found := append(left, right...)
+
+		switch {
+		case lerr != nil && rerr != nil:
+			return found, fmt.Errorf("%w; %s", lerr, rerr)
+		case lerr != nil:
+			return found, lerr
+		case rerr != nil:
+			return found, rerr
+		default:
+			return found, nil
+		}
+	}
+	if err != nil {
+		return found, err
+	}
+
+	return found, nil
+}
+
+// isQuotaExceeded reports whether a googleapi error is GCP's way of saying
+// "you are being rate limited", which doesn't always come back as HTTP 429.
+func isQuotaExceeded(err *googleapi.Error) bool {
+	for _, e := range err.Errors {
+		if e.Reason == "quotaExceeded" || e.Reason == "rateLimitExceeded" {
+			return true
+		}
+	}
+	return false
+}
+
+// retryAfter extracts the Retry-After header from a googleapi error, if any.
+func retryAfter(err *googleapi.Error) time.Duration {
+	if err.Header == nil {
+		return 0
+	}
+
+	ra := err.Header.Get("Retry-After")
+	if ra == "" {
+		return 0
+	}
+
+	if secs, parseErr := strconv.Atoi(ra); parseErr == nil {
+		return time.Duration(secs) * time.Second
+	}
+
+	return 0
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+// TestCheckPermissionsWithRetryMixedChunk verifies that a chunk containing
+// one permission the target rejects with INVALID_ARGUMENT alongside
+// permissions the target genuinely holds still reports every held
+// permission, rather than letting the invalid permission's failure discard
+// its siblings' results.
+func TestCheckPermissionsWithRetryMixedChunk(t *testing.T) {
+	perms := []string{"a.get", "b.get", "c.get", "d.get"}
+	invalid := "c.get"
+
+	test := func(ctx context.Context, chunk []string) ([]string, error) {
+		for _, p := range chunk {
+			if p == invalid {
+				return nil, &googleapi.Error{Code: 400}
+			}
+		}
+		return chunk, nil
+	}
+
+	sizer := newChunkSizer(len(perms))
+	found, err := checkPermissionsWithRetry(context.Background(), perms, sizer, test)
+	if err == nil {
+		t.Fatalf("expected an error for the invalid permission, got none")
+	}
+
+	want := map[string]bool{"a.get": true, "b.get": true, "d.get": true}
+	got := map[string]bool{}
+	for _, p := range found {
+		got[p] = true
+	}
+
+	for p := range want {
+		if !got[p] {
+			t.Errorf("expected %s to be reported as found, but it was dropped (found=%v)", p, found)
+		}
+	}
+	if got[invalid] {
+		t.Errorf("did not expect %s to be reported as found", invalid)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/secretmanager/v1"
+)
+
+var secretRegexp = regexp.MustCompile(`^//secretmanager\.googleapis\.com/(projects/[^/]+/secrets/[^/]+)$`)
+
+// secretTarget is a Secret Manager secret, checked via
+// secretmanager.Projects.Secrets.TestIamPermissions.
+type secretTarget struct {
+	client *secretmanager.Service
+	secret string
+}
+
+func newSecretTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceURL string) (Target, error) {
+	m := secretRegexp.FindStringSubmatch(resourceURL)
+	if m == nil {
+		return nil, fmt.Errorf("expected //secretmanager.googleapis.com/projects/P/secrets/S, got %q", resourceURL)
+	}
+
+	client, err := secretmanager.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating secretmanager client: %w", err)
+	}
+
+	return secretTarget{client: client, secret: m[1]}, nil
+}
+
+func (t secretTarget) Path() string { return "//secretmanager.googleapis.com/" + t.secret }
+
+func (t secretTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "secretmanager.")
+}
+
+func (t secretTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Projects.Secrets.TestIamPermissions(t.secret, &secretmanager.TestIamPermissionsRequest{
+		Permissions: perms,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/iam/v1"
+	"google.golang.org/api/option"
+)
+
+var serviceAccountRegexp = regexp.MustCompile(`^//iam\.googleapis\.com/(projects/[^/]+/serviceAccounts/[^/]+)$`)
+
+// serviceAccountTarget is an individual service account, checked via
+// iam.Projects.ServiceAccounts.TestIamPermissions.
+type serviceAccountTarget struct {
+	client         *iam.Service
+	serviceAccount string
+}
+
+func newServiceAccountTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceURL string) (Target, error) {
+	m := serviceAccountRegexp.FindStringSubmatch(resourceURL)
+	if m == nil {
+		return nil, fmt.Errorf("expected //iam.googleapis.com/projects/P/serviceAccounts/SA, got %q", resourceURL)
+	}
+
+	client, err := iam.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating iam client: %w", err)
+	}
+
+	return serviceAccountTarget{client: client, serviceAccount: m[1]}, nil
+}
+
+func (t serviceAccountTarget) Path() string { return "//iam.googleapis.com/" + t.serviceAccount }
+
+func (t serviceAccountTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "iam.")
+}
+
+func (t serviceAccountTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Projects.ServiceAccounts.TestIamPermissions(t.serviceAccount, &iam.TestIamPermissionsRequest{
+		Permissions: perms,
+	}).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
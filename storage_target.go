@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+)
+
+// bucketTarget is a GCS bucket, checked via storage.Buckets.TestIamPermissions.
+type bucketTarget struct {
+	client *storage.Service
+	bucket string
+}
+
+func newBucketTarget(ctx context.Context, tokenSource oauth2.TokenSource, bucket string) (Target, error) {
+	client, err := storage.NewService(ctx, option.WithTokenSource(tokenSource))
+	if err != nil {
+		return nil, fmt.Errorf("creating storage client: %w", err)
+	}
+
+	return bucketTarget{client: client, bucket: bucket}, nil
+}
+
+func (t bucketTarget) Path() string { return "gs://" + t.bucket }
+
+func (t bucketTarget) FilterPermissions(all []string) []string {
+	return permissionPrefixFilter(all, "storage.")
+}
+
+func (t bucketTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	resp, err := t.client.Buckets.TestIamPermissions(t.bucket, perms).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Permissions, nil
+}
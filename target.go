@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudresourcemanager/v3"
+)
+
+// Target is a single IAM-testable resource: a project, folder, or
+// organization via the Cloud Resource Manager API, or an individual
+// resource (bucket, instance, topic, key, secret, service account) via its
+// own API's TestIamPermissions method.
+type Target interface {
+	// Path is the resource identifier used as the result key and in output.
+	Path() string
+	// FilterPermissions narrows the master permission list down to the ones
+	// whose API prefix this target actually accepts, so a chunked run
+	// doesn't waste calls on permissions that can never apply here.
+	FilterPermissions(all []string) []string
+	// TestPermissions calls this target's TestIamPermissions with perms,
+	// which must already be limited to a chunk this target accepts.
+	TestPermissions(ctx context.Context, perms []string) ([]string, error)
+}
+
+// permissionPrefixFilter returns the permissions in all whose dotted
+// service prefix (e.g. "storage.") matches one of prefixes.
+func permissionPrefixFilter(all []string, prefixes ...string) []string {
+	var filtered []string
+	for _, p := range all {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(p, prefix) {
+				filtered = append(filtered, p)
+				break
+			}
+		}
+	}
+	return filtered
+}
+
+// crmTarget is a project, folder, or organization checked via the Cloud
+// Resource Manager API. It accepts the whole master permission list, since
+// CRM permissions span every service.
+type crmTarget struct {
+	client *cloudresourcemanager.Service
+	path   string
+}
+
+func (t crmTarget) Path() string { return t.path }
+
+func (t crmTarget) FilterPermissions(all []string) []string { return all }
+
+func (t crmTarget) TestPermissions(ctx context.Context, perms []string) ([]string, error) {
+	return checkPermissions(perms, t.client, t.path)
+}
+
+// parseTarget builds the Target implementation matching a -resource value:
+// a gs:// bucket URL, or a //<service>.googleapis.com/... full resource
+// name for Compute, Pub/Sub, Cloud KMS, Secret Manager, or IAM service
+// accounts.
+func parseTarget(ctx context.Context, tokenSource oauth2.TokenSource, resourceArg string) (Target, error) {
+	switch {
+	case strings.HasPrefix(resourceArg, "gs://"):
+		return newBucketTarget(ctx, tokenSource, strings.TrimPrefix(resourceArg, "gs://"))
+	case strings.HasPrefix(resourceArg, "//compute.googleapis.com/"):
+		return newComputeInstanceTarget(ctx, tokenSource, resourceArg)
+	case strings.HasPrefix(resourceArg, "//pubsub.googleapis.com/"):
+		return newPubsubTopicTarget(ctx, tokenSource, resourceArg)
+	case strings.HasPrefix(resourceArg, "//cloudkms.googleapis.com/"):
+		return newKMSKeyTarget(ctx, tokenSource, resourceArg)
+	case strings.HasPrefix(resourceArg, "//secretmanager.googleapis.com/"):
+		return newSecretTarget(ctx, tokenSource, resourceArg)
+	case strings.HasPrefix(resourceArg, "//iam.googleapis.com/"):
+		return newServiceAccountTarget(ctx, tokenSource, resourceArg)
+	default:
+		return nil, fmt.Errorf("unrecognized -resource %q (want gs://bucket or a //<service>.googleapis.com/... resource URL)", resourceArg)
+	}
+}